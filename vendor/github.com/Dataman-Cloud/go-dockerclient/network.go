@@ -5,10 +5,17 @@
 package docker
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
 	"golang.org/x/net/context"
 )
@@ -31,6 +38,26 @@ type Network struct {
 	Internal   bool
 	EnableIPv6 bool `json:"EnableIPv6"`
 	Labels     map[string]string
+	Services   map[string]NetworkService `json:",omitempty"`
+}
+
+// NetworkService describes a swarm service attached to a network, as
+// returned by NetworkInfoWithOptions when NetworkInspectOptions.Verbose is
+// set.
+type NetworkService struct {
+	ID    string `json:",omitempty"`
+	Name  string `json:",omitempty"`
+	VIP   string `json:",omitempty"`
+	Ports []string
+	Tasks []NetworkTask
+}
+
+// NetworkTask describes a single swarm task endpoint attached to a network,
+// as carried in NetworkService.Tasks.
+type NetworkTask struct {
+	Name       string
+	EndpointIP string
+	Info       map[string]string
 }
 
 // Endpoint contains network resources allocated and used for a container in a network
@@ -89,7 +116,41 @@ func (c *Client) FilteredListNetworks(opts NetworkFilterOpts) ([]Network, error)
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) NetworkInfo(id string) (*Network, error) {
+	return c.NetworkInfoWithOptions(id, NetworkInspectOptions{})
+}
+
+// NetworkInspectOptions specify parameters to the NetworkInfoWithOptions
+// function.
+//
+// See https://goo.gl/6GugX3 for more details.
+type NetworkInspectOptions struct {
+	// Verbose requests the swarm-scope service and task details for the
+	// network, populating Network.Services. Available since Docker API
+	// 1.27.
+	Verbose bool
+
+	// Scope restricts the inspect to a network with a matching scope
+	// ("local", "global" or "swarm"), which disambiguates networks that
+	// share a name across scopes.
+	Scope string
+}
+
+// NetworkInfoWithOptions returns information about a network by its ID,
+// optionally including the swarm services and tasks attached to it.
+//
+// See https://goo.gl/6GugX3 for more details.
+func (c *Client) NetworkInfoWithOptions(id string, opts NetworkInspectOptions) (*Network, error) {
+	params := make(url.Values)
+	if opts.Verbose {
+		params.Set("verbose", "true")
+	}
+	if opts.Scope != "" {
+		params.Set("scope", opts.Scope)
+	}
 	path := "/networks/" + id
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
 	resp, err := c.do("GET", path, doOptions{})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
@@ -110,15 +171,29 @@ func (c *Client) NetworkInfo(id string) (*Network, error) {
 //
 // See https://goo.gl/6GugX3 for more details.
 type CreateNetworkOptions struct {
-	Name           string                 `json:"Name" yaml:"Name"`
-	CheckDuplicate bool                   `json:"CheckDuplicate" yaml:"CheckDuplicate"`
-	Driver         string                 `json:"Driver" yaml:"Driver"`
-	IPAM           IPAMOptions            `json:"IPAM" yaml:"IPAM"`
-	Options        map[string]interface{} `json:"Options" yaml:"Options"`
-	Labels         map[string]string      `json:"Labels" yaml:"Labels"`
-	Internal       bool                   `json:"Internal" yaml:"Internal"`
-	EnableIPv6     bool                   `json:"EnableIPv6" yaml:"EnableIPv6"`
-	Context        context.Context        `json:"-"`
+	Name           string                  `json:"Name" yaml:"Name"`
+	CheckDuplicate bool                    `json:"CheckDuplicate" yaml:"CheckDuplicate"`
+	Driver         string                  `json:"Driver" yaml:"Driver"`
+	IPAM           IPAMOptions             `json:"IPAM" yaml:"IPAM"`
+	Options        map[string]interface{}  `json:"Options" yaml:"Options"`
+	Labels         map[string]string       `json:"Labels" yaml:"Labels"`
+	Internal       bool                    `json:"Internal" yaml:"Internal"`
+	EnableIPv6     bool                    `json:"EnableIPv6" yaml:"EnableIPv6"`
+	Attachable     bool                    `json:"Attachable" yaml:"Attachable"`
+	Ingress        bool                    `json:"Ingress" yaml:"Ingress"`
+	ConfigOnly     bool                    `json:"ConfigOnly" yaml:"ConfigOnly"`
+	ConfigFrom     *NetworkConfigReference `json:"ConfigFrom,omitempty" yaml:"ConfigFrom,omitempty"`
+	Scope          string                  `json:"Scope,omitempty" yaml:"Scope,omitempty"`
+	Context        context.Context         `json:"-"`
+}
+
+// NetworkConfigReference identifies the network a config-only network
+// (CreateNetworkOptions.ConfigOnly) takes its configuration from, via
+// CreateNetworkOptions.ConfigFrom.
+//
+// See https://goo.gl/6GugX3 for more details.
+type NetworkConfigReference struct {
+	Network string `json:"Network" yaml:"Network"`
 }
 
 // IPAMOptions controls IP Address Management when creating a network
@@ -139,6 +214,241 @@ type IPAMConfig struct {
 	AuxAddress map[string]string `json:"AuxiliaryAddresses,omitempty"`
 }
 
+// ipamPluginSockDir is where the Docker daemon looks for Unix-socket-based
+// plugins, including remote IPAM drivers registered with RegisterIPAMDriver.
+const ipamPluginSockDir = "/run/docker/plugins"
+
+// IPAMDriver is implemented by types that back a libnetwork Remote IPAM
+// plugin registered through Client.RegisterIPAMDriver. Its methods mirror
+// the plugin's wire protocol one-to-one.
+//
+// See https://github.com/docker/libnetwork/blob/master/docs/ipam.md for the
+// protocol this interface serves.
+type IPAMDriver interface {
+	GetCapabilities() (*IPAMDriverCapabilities, error)
+	GetDefaultAddressSpaces() (local string, global string, err error)
+	RequestPool(opts IPAMPoolRequest) (*IPAMPoolResponse, error)
+	ReleasePool(poolID string) error
+	RequestAddress(poolID, address string, opts map[string]string) (string, error)
+	ReleaseAddress(poolID, address string) error
+}
+
+// IPAMDriverCapabilities is returned from IPAMDriver.GetCapabilities.
+type IPAMDriverCapabilities struct {
+	RequiresMACAddress    bool
+	RequiresRequestReplay bool
+}
+
+// IPAMPoolRequest carries the parameters of a RequestPool call made against
+// an IPAMDriver.
+type IPAMPoolRequest struct {
+	AddressSpace string
+	Pool         string
+	SubPool      string
+	Options      map[string]string
+	V6           bool
+}
+
+// IPAMPoolResponse is returned from IPAMDriver.RequestPool.
+type IPAMPoolResponse struct {
+	PoolID string
+	Pool   string
+	Data   map[string]string
+}
+
+// RegisterIPAMDriver wires drv up to the libnetwork Remote IPAM plugin
+// protocol and returns an http.Handler that serves it. The caller is
+// responsible for exposing the handler under the Unix socket or TCP address
+// the Docker daemon expects for a plugin named name, typically
+// ipamPluginSockDir/<name>.sock.
+//
+// See https://github.com/docker/libnetwork/blob/master/docs/ipam.md for more
+// details.
+func (c *Client) RegisterIPAMDriver(name string, drv IPAMDriver) (http.Handler, error) {
+	if name == "" {
+		return nil, errors.New("docker: IPAM driver name cannot be empty")
+	}
+	if drv == nil {
+		return nil, errors.New("docker: IPAM driver cannot be nil")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Plugin.Activate", func(w http.ResponseWriter, r *http.Request) {
+		writeIPAMResponse(w, map[string]interface{}{"Implements": []string{"IpamDriver"}})
+	})
+	mux.HandleFunc("/IpamDriver.GetCapabilities", func(w http.ResponseWriter, r *http.Request) {
+		caps, err := drv.GetCapabilities()
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeIPAMResponse(w, caps)
+	})
+	mux.HandleFunc("/IpamDriver.GetDefaultAddressSpaces", func(w http.ResponseWriter, r *http.Request) {
+		local, global, err := drv.GetDefaultAddressSpaces()
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeIPAMResponse(w, map[string]string{
+			"LocalDefaultAddressSpace":  local,
+			"GlobalDefaultAddressSpace": global,
+		})
+	})
+	mux.HandleFunc("/IpamDriver.RequestPool", func(w http.ResponseWriter, r *http.Request) {
+		var req IPAMPoolRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		resp, err := drv.RequestPool(req)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeIPAMResponse(w, resp)
+	})
+	mux.HandleFunc("/IpamDriver.ReleasePool", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ PoolID string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		if err := drv.ReleasePool(req.PoolID); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeIPAMResponse(w, map[string]string{})
+	})
+	mux.HandleFunc("/IpamDriver.RequestAddress", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			PoolID  string
+			Address string
+			Options map[string]string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		addr, err := drv.RequestAddress(req.PoolID, req.Address, req.Options)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeIPAMResponse(w, map[string]interface{}{"Address": addr, "Data": map[string]string{}})
+	})
+	mux.HandleFunc("/IpamDriver.ReleaseAddress", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			PoolID  string
+			Address string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		if err := drv.ReleaseAddress(req.PoolID, req.Address); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeIPAMResponse(w, map[string]string{})
+	})
+
+	return mux, nil
+}
+
+func writeIPAMResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeIPAMError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusInternalServerError)
+	writeIPAMResponse(w, map[string]string{"Err": err.Error()})
+}
+
+// RequestAddress asks the remote IPAM plugin named name to allocate an
+// address from pool, optionally passing driver-specific opts, and returns
+// the address it allocated. No specific address is requested; the plugin
+// picks one. Cancel ctx to abandon the call if the plugin is slow or wedged.
+//
+// See https://github.com/docker/libnetwork/blob/master/docs/ipam.md for more
+// details.
+func (c *Client) RequestAddress(ctx context.Context, name, pool string, opts map[string]string) (string, error) {
+	req := struct {
+		PoolID  string
+		Address string
+		Options map[string]string
+	}{PoolID: pool, Options: opts}
+
+	var resp struct {
+		Address string
+		Data    map[string]string
+	}
+	if err := callIPAMPlugin(ctx, name, "RequestAddress", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Address, nil
+}
+
+// ReleaseAddress asks the remote IPAM plugin named name to release addr
+// back into pool. Cancel ctx to abandon the call if the plugin is slow or
+// wedged.
+//
+// See https://github.com/docker/libnetwork/blob/master/docs/ipam.md for more
+// details.
+func (c *Client) ReleaseAddress(ctx context.Context, name, pool, addr string) error {
+	req := struct {
+		PoolID  string
+		Address string
+	}{PoolID: pool, Address: addr}
+
+	return callIPAMPlugin(ctx, name, "ReleaseAddress", req, nil)
+}
+
+// callIPAMPlugin sends a libnetwork Remote IPAM plugin request over the
+// Unix socket the Docker daemon would use to reach the plugin named name,
+// and decodes the JSON response into out (when non-nil). The request is
+// bound to ctx so a slow or wedged plugin can't hang the caller forever.
+func callIPAMPlugin(ctx context.Context, name, method string, req interface{}, out interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", filepath.Join(ipamPluginSockDir, name+".sock"))
+			},
+		},
+	}
+	httpReq, err := http.NewRequest("POST", "http://plugin/IpamDriver."+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var pluginErr struct{ Err string }
+		json.NewDecoder(resp.Body).Decode(&pluginErr)
+		if pluginErr.Err != "" {
+			return errors.New(pluginErr.Err)
+		}
+		return fmt.Errorf("docker: IPAM plugin %q: unexpected status %d", name, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
 // CreateNetwork creates a new network, returning the network instance,
 // or an error in case of failure.
 //
@@ -178,6 +488,34 @@ func (c *Client) CreateNetwork(opts CreateNetworkOptions) (*Network, error) {
 	return &network, nil
 }
 
+// EnsureNetwork creates a network unless one with the same name already
+// exists, in which case the existing network is returned instead of
+// ErrNetworkAlreadyExists. The returned bool reports whether a new network
+// was created.
+func (c *Client) EnsureNetwork(opts CreateNetworkOptions) (*Network, bool, error) {
+	opts.CheckDuplicate = true
+	network, err := c.CreateNetwork(opts)
+	if err == nil {
+		return network, true, nil
+	}
+	if err != ErrNetworkAlreadyExists {
+		return nil, false, err
+	}
+
+	networks, err := c.FilteredListNetworks(NetworkFilterOpts{
+		"name": {opts.Name: true},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	for _, n := range networks {
+		if n.Name == opts.Name {
+			return &n, false, nil
+		}
+	}
+	return nil, false, &NoSuchNetwork{ID: opts.Name}
+}
+
 // RemoveNetwork removes a network or returns an error in case of failure.
 //
 // See https://goo.gl/6GugX3 for more details.
@@ -193,6 +531,91 @@ func (c *Client) RemoveNetwork(id string) error {
 	return nil
 }
 
+// PruneNetworksOptions specify parameters to the PruneNetworks function.
+type PruneNetworksOptions struct {
+	Filters NetworkFilterOpts
+	Context context.Context
+}
+
+// PruneNetworksResults specify the results from a PruneNetworks call.
+type PruneNetworksResults struct {
+	NetworksDeleted []string
+}
+
+// PruneNetworks deletes networks which are unused. Filters can restrict the
+// candidates using "label", "label!" and "until" keys, mirroring the Docker
+// CLI's `docker network prune --filter`.
+func (c *Client) PruneNetworks(opts PruneNetworksOptions) (*PruneNetworksResults, error) {
+	params, err := json.Marshal(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+	path := "/networks/prune?filters=" + string(params)
+	resp, err := c.do("POST", path, doOptions{context: opts.Context})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var results PruneNetworksResults
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
+// networkPruneMatchingConcurrency bounds how many RemoveNetwork calls
+// PruneNetworksMatching has in flight at once.
+const networkPruneMatchingConcurrency = 8
+
+// PruneNetworksMatching lists networks, removes every one for which match
+// returns true, up to networkPruneMatchingConcurrency at a time, and returns
+// the names of the networks it removed. A network another caller already
+// removed concurrently is not treated as a failure.
+func (c *Client) PruneNetworksMatching(match func(Network) bool) ([]string, error) {
+	networks, err := c.ListNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		removed  []string
+		firstErr error
+		sem      = make(chan struct{}, networkPruneMatchingConcurrency)
+	)
+	for _, network := range networks {
+		if !match(network) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n Network) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := c.RemoveNetwork(n.ID)
+			switch err.(type) {
+			case nil:
+				mu.Lock()
+				removed = append(removed, n.Name)
+				mu.Unlock()
+			case *NoSuchNetwork:
+				// Already gone; not an error for a prune.
+			default:
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(network)
+	}
+	wg.Wait()
+
+	return removed, firstErr
+}
+
 // NetworkConnectionOptions specify parameters to the ConnectNetwork and
 // DisconnectNetwork function.
 //
@@ -255,6 +678,23 @@ func (c *Client) ConnectNetwork(id string, opts NetworkConnectionOptions) error
 	return nil
 }
 
+// EnsureContainerConnected connects container to network unless it is
+// already attached to it, in which case it is a no-op.
+func (c *Client) EnsureContainerConnected(networkID, containerID string, config *EndpointConfig) error {
+	network, err := c.NetworkInfo(networkID)
+	if err != nil {
+		return err
+	}
+	if _, ok := network.Containers[containerID]; ok {
+		return nil
+	}
+
+	return c.ConnectNetwork(networkID, NetworkConnectionOptions{
+		Container:      containerID,
+		EndpointConfig: config,
+	})
+}
+
 // DisconnectNetwork removes a container from a network or returns an error in
 // case of failure.
 //
@@ -271,6 +711,112 @@ func (c *Client) DisconnectNetwork(id string, opts NetworkConnectionOptions) err
 	return nil
 }
 
+// NetworkEventsOptions specify parameters to the NetworkEvents function.
+type NetworkEventsOptions struct {
+	// Since, if set, drops network events that occurred before this time
+	// (Unix timestamp, optionally "seconds.nanoseconds"). Events come from
+	// the client's shared live event stream, so events that occurred
+	// before NetworkEvents was called are not replayed.
+	Since string
+
+	// Until, if set, stops delivery once an event at or after this time
+	// is seen; it has no effect on events the shared listener already
+	// delivered before NetworkEvents started filtering them.
+	Until string
+
+	Context context.Context
+}
+
+// NetworkEvent is a single network-scoped event delivered by NetworkEvents,
+// translated from the daemon's generic event stream filtered to
+// type=network.
+type NetworkEvent struct {
+	Action      string
+	NetworkID   string
+	ContainerID string
+	Scope       string
+	Time        int64
+	TimeNano    int64
+}
+
+// parseEventTimestamp parses a Docker event timestamp of the form
+// "seconds" or "seconds.nanoseconds", as used by the since/until fields of
+// NetworkEventsOptions. ok is false for an empty or malformed string.
+func parseEventTimestamp(s string) (sec, nsec int64, ok bool) {
+	if s == "" {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(s, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if len(parts) == 2 {
+		nsec, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return sec, nsec, true
+}
+
+// NetworkEvents subscribes to network topology changes reported by the
+// Docker daemon and delivers them as typed NetworkEvent values on the
+// returned channel, which is closed once ctx is done. It rides the
+// client's existing shared event subscription (see
+// AddEventListenerWithOptions) rather than opening a second /events
+// connection per subscriber, so every caller - including ones consuming
+// the generic events API directly - shares one connection and its
+// reconnect handling.
+func (c *Client) NetworkEvents(ctx context.Context, opts NetworkEventsOptions) (<-chan NetworkEvent, error) {
+	since, sinceNsec, hasSince := parseEventTimestamp(opts.Since)
+	until, untilNsec, hasUntil := parseEventTimestamp(opts.Until)
+
+	listener := make(chan *APIEvents, 64)
+	if err := c.AddEventListenerWithOptions(EventsOptions{
+		Filters: map[string][]string{"type": {"network"}},
+	}, listener); err != nil {
+		return nil, err
+	}
+
+	out := make(chan NetworkEvent)
+	go func() {
+		defer close(out)
+		defer c.RemoveEventListener(listener)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-listener:
+				if !ok {
+					return
+				}
+				if hasSince && (evt.Time < since || (evt.Time == since && evt.TimeNano%1e9 < sinceNsec)) {
+					continue
+				}
+				if hasUntil && (evt.Time > until || (evt.Time == until && evt.TimeNano%1e9 >= untilNsec)) {
+					return
+				}
+				event := NetworkEvent{
+					Action:      evt.Action,
+					NetworkID:   evt.Actor.ID,
+					ContainerID: evt.Actor.Attributes["container"],
+					Scope:       evt.Actor.Attributes["scope"],
+					Time:        evt.Time,
+					TimeNano:    evt.TimeNano,
+				}
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
 // NoSuchNetwork is the error returned when a given network does not exist.
 type NoSuchNetwork struct {
 	ID string